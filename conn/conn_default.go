@@ -10,6 +10,7 @@ package conn
 import (
 	"net"
 	"os"
+	"sync"
 	"syscall"
 )
 
@@ -25,6 +26,7 @@ type nativeBind struct {
 	ipv6       *net.UDPConn
 	blackhole4 bool
 	blackhole6 bool
+	closing    sync.Once
 }
 
 type NativeEndpoint net.UDPAddr
@@ -119,12 +121,14 @@ func createBind(uport uint16) (Bind, uint16, error) {
 
 func (bind *nativeBind) Close() error {
 	var err1, err2 error
-	if bind.ipv4 != nil {
-		err1 = bind.ipv4.Close()
-	}
-	if bind.ipv6 != nil {
-		err2 = bind.ipv6.Close()
-	}
+	bind.closing.Do(func() {
+		if bind.ipv4 != nil {
+			err1 = bind.ipv4.Close()
+		}
+		if bind.ipv6 != nil {
+			err2 = bind.ipv6.Close()
+		}
+	})
 	if err1 != nil {
 		return err1
 	}
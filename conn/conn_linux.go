@@ -63,6 +63,7 @@ type nativeBind struct {
 	sock4    int
 	sock6    int
 	lastMark uint32
+	closing  sync.Once
 }
 
 var _ Endpoint = (*NativeEndpoint)(nil)
@@ -177,14 +178,19 @@ func closeUnblock(fd int) error {
 	return unix.Close(fd)
 }
 
+/* Only the first call closes the sockets, so that a descriptor number
+ * already reused elsewhere in the process is never closed a second time.
+ */
 func (bind *nativeBind) Close() error {
 	var err1, err2 error
-	if bind.sock6 != -1 {
-		err1 = closeUnblock(bind.sock6)
-	}
-	if bind.sock4 != -1 {
-		err2 = closeUnblock(bind.sock4)
-	}
+	bind.closing.Do(func() {
+		if bind.sock6 != -1 {
+			err1 = closeUnblock(bind.sock6)
+		}
+		if bind.sock4 != -1 {
+			err2 = closeUnblock(bind.sock4)
+		}
+	})
 
 	if err1 != nil {
 		return err1
@@ -38,4 +38,6 @@ const (
 	UnderLoadQueueSize = QueueHandshakeSize / 8
 	UnderLoadAfterTime = time.Second // how long does the device remain under load after detected
 	MaxPeers           = 1 << 16     // maximum number of configured peers
+
+	ReceiveErrorLogInterval = time.Minute // how often dropped datagrams are summarised in the log
 )
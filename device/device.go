@@ -20,6 +20,9 @@ import (
 )
 
 type Device struct {
+	// accessed atomically, so kept first to be 64-bit aligned on 32-bit platforms
+	handshakeTimestampTolerance int64 // time.Duration
+
 	isUp     AtomicBool // device is (going) up
 	isClosed AtomicBool // device is closed? (acting as guard)
 	log      *Logger
@@ -61,6 +64,8 @@ type Device struct {
 	indexTable    IndexTable
 	cookieChecker CookieChecker
 
+	telemetry atomic.Value // telemetryHolder
+
 	rate struct {
 		underLoadUntil atomic.Value
 		limiter        ratelimiter.Ratelimiter
@@ -89,6 +94,9 @@ type Device struct {
 		device tun.Device
 		mtu    int32
 	}
+
+	// variable size, so kept clear of atomically accessed 64-bit fields
+	receiveErrors receiveErrors
 }
 
 /* Converts the peer into a "zombie", which remains in the peer map,
@@ -254,6 +262,13 @@ func (device *Device) SetPrivateKey(sk NoisePrivateKey) error {
 }
 
 func NewDevice(tunDevice tun.Device, logger *Logger) *Device {
+	return NewDeviceWithWorkers(tunDevice, logger, 0)
+}
+
+// NewDeviceWithWorkers is like NewDevice, but starts the given number of
+// encryption, decryption and handshake workers instead of one of each per CPU.
+// A non-positive number selects the default.
+func NewDeviceWithWorkers(tunDevice tun.Device, logger *Logger, workers int) *Device {
 	device := new(Device)
 
 	device.isUp.Set(false)
@@ -273,6 +288,7 @@ func NewDevice(tunDevice tun.Device, logger *Logger) *Device {
 
 	device.rate.limiter.Init()
 	device.rate.underLoadUntil.Store(time.Time{})
+	device.telemetry.Store(telemetryHolder{})
 
 	device.indexTable.Init()
 	device.allowedips.Reset()
@@ -296,10 +312,12 @@ func NewDevice(tunDevice tun.Device, logger *Logger) *Device {
 
 	// start workers
 
-	cpus := runtime.NumCPU()
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
 	device.state.starting.Wait()
 	device.state.stopping.Wait()
-	for i := 0; i < cpus; i += 1 {
+	for i := 0; i < workers; i += 1 {
 		device.state.starting.Add(3)
 		device.state.stopping.Add(3)
 		go device.RoutineEncryption()
@@ -421,6 +439,7 @@ func unsafeCloseBind(device *Device) error {
 	netc := &device.net
 	if netc.netlinkCancel != nil {
 		netc.netlinkCancel.Cancel()
+		netc.netlinkCancel = nil
 	}
 	if netc.bind != nil {
 		err = netc.bind.Close()
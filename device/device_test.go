@@ -8,11 +8,17 @@ package device
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 
 	"golang.zx2c4.com/wireguard/tun/tuntest"
 )
@@ -26,11 +32,11 @@ func getFreePort(t *testing.T) string {
 	return fmt.Sprintf("%d", l.LocalAddr().(*net.UDPAddr).Port)
 }
 
-func TestTwoDevicePing(t *testing.T) {
+func genConfigs(t *testing.T) (cfg1, cfg2 string) {
 	port1 := getFreePort(t)
 	port2 := getFreePort(t)
 
-	cfg1 := `private_key=481eb0d8113a4a5da532d2c3e9c14b53c8454b34ab109676f6b58c2245e37b58
+	cfg1 = `private_key=481eb0d8113a4a5da532d2c3e9c14b53c8454b34ab109676f6b58c2245e37b58
 listen_port={{PORT1}}
 replace_peers=true
 public_key=f70dbb6b1b92a1dde1c783b297016af3f572fef13b0abb16a2623d89a58e9725
@@ -41,15 +47,7 @@ endpoint=127.0.0.1:{{PORT2}}`
 	cfg1 = strings.ReplaceAll(cfg1, "{{PORT1}}", port1)
 	cfg1 = strings.ReplaceAll(cfg1, "{{PORT2}}", port2)
 
-	tun1 := tuntest.NewChannelTUN()
-	dev1 := NewDevice(tun1.TUN(), NewLogger(LogLevelDebug, "dev1: "))
-	dev1.Up()
-	defer dev1.Close()
-	if err := dev1.IpcSetOperation(bufio.NewReader(strings.NewReader(cfg1))); err != nil {
-		t.Fatal(err)
-	}
-
-	cfg2 := `private_key=98c7989b1661a0d64fd6af3502000f87716b7c4bbcf00d04fc6073aa7b539768
+	cfg2 = `private_key=98c7989b1661a0d64fd6af3502000f87716b7c4bbcf00d04fc6073aa7b539768
 listen_port={{PORT2}}
 replace_peers=true
 public_key=49e80929259cebdda4f322d6d2b1a6fad819d603acd26fd5d845e7a123036427
@@ -60,14 +58,38 @@ endpoint=127.0.0.1:{{PORT1}}`
 	cfg2 = strings.ReplaceAll(cfg2, "{{PORT1}}", port1)
 	cfg2 = strings.ReplaceAll(cfg2, "{{PORT2}}", port2)
 
-	tun2 := tuntest.NewChannelTUN()
-	dev2 := NewDevice(tun2.TUN(), NewLogger(LogLevelDebug, "dev2: "))
+	return
+}
+
+// genTestPair creates two connected devices. The caller must close them.
+func genTestPair(t *testing.T) (tun1, tun2 *tuntest.ChannelTUN, dev1, dev2 *Device) {
+	cfg1, cfg2 := genConfigs(t)
+
+	tun1 = tuntest.NewChannelTUN()
+	dev1 = NewDevice(tun1.TUN(), NewLogger(LogLevelDebug, "dev1: "))
+	dev1.Up()
+	if err := dev1.IpcSetOperation(bufio.NewReader(strings.NewReader(cfg1))); err != nil {
+		dev1.Close()
+		t.Fatal(err)
+	}
+
+	tun2 = tuntest.NewChannelTUN()
+	dev2 = NewDevice(tun2.TUN(), NewLogger(LogLevelDebug, "dev2: "))
 	dev2.Up()
-	defer dev2.Close()
 	if err := dev2.IpcSetOperation(bufio.NewReader(strings.NewReader(cfg2))); err != nil {
+		dev1.Close()
+		dev2.Close()
 		t.Fatal(err)
 	}
 
+	return
+}
+
+func TestTwoDevicePing(t *testing.T) {
+	tun1, tun2, dev1, dev2 := genTestPair(t)
+	defer dev1.Close()
+	defer dev2.Close()
+
 	t.Run("ping 1.0.0.1", func(t *testing.T) {
 		msg2to1 := tuntest.Ping(net.ParseIP("1.0.0.1"), net.ParseIP("1.0.0.2"))
 		tun2.Outbound <- msg2to1
@@ -118,3 +140,210 @@ func randDevice(t *testing.T) *Device {
 	device.SetPrivateKey(sk)
 	return device
 }
+
+func randPeer(t *testing.T, device *Device) *Peer {
+	t.Helper()
+	sk, err := newPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := device.NewPeer(sk.publicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer
+}
+
+// ipcQuery runs a UAPI operation and returns the response lines,
+// up to the terminating empty line.
+func ipcQuery(t *testing.T, device *Device, op string) []string {
+	t.Helper()
+	client, server := net.Pipe()
+	go device.IpcHandle(server)
+	defer client.Close()
+
+	if _, err := client.Write([]byte(op + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(client)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// TestDeviceAlignment checks that atomically-accessed fields are
+// aligned to 64-bit boundaries, as required by the atomic package.
+func TestDeviceAlignment(t *testing.T) {
+	var d Device
+	checkAlignment(t, "Device.handshakeTimestampTolerance", unsafe.Offsetof(d.handshakeTimestampTolerance))
+}
+
+func TestCloseLeaksNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		tun1, tun2, dev1, dev2 := genTestPair(t)
+		msg := tuntest.Ping(net.ParseIP("1.0.0.1"), net.ParseIP("1.0.0.2"))
+		tun2.Outbound <- msg
+		select {
+		case <-tun1.Inbound:
+		case <-time.After(300 * time.Millisecond):
+			t.Error("ping did not transit")
+		}
+		dev1.Close()
+		dev2.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("%d goroutines leaked after closing devices:\n%s", runtime.NumGoroutine()-before, buf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func openFDs(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("cannot count open file descriptors:", err)
+	}
+	return len(fds)
+}
+
+func TestUpDownLeaksNothing(t *testing.T) {
+	_, _, dev1, dev2 := genTestPair(t)
+	defer dev2.Close()
+
+	// keep finalizers from closing leaked descriptors behind our back
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	goroutines := runtime.NumGoroutine()
+	fds := openFDs(t)
+
+	for i := 0; i < 20; i++ {
+		bind := dev1.Bind()
+		dev1.Down()
+		if err := bind.Close(); err != nil {
+			t.Fatal("closing a closed bind failed:", err)
+		}
+		if err := dev1.BindClose(); err != nil {
+			t.Fatal("closing a device without a bind failed:", err)
+		}
+		dev1.Up()
+	}
+
+	if n := openFDs(t); n != fds {
+		t.Errorf("leaked %d file descriptors over up/down cycles", n-fds)
+	}
+
+	// stopped goroutines may still be unwinding after signalling completion
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked %d goroutines over up/down cycles", runtime.NumGoroutine()-goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	dev1.Close()
+	dev1.Close()
+}
+
+func TestRoamingKeepsSession(t *testing.T) {
+	tun1, tun2, dev1, dev2 := genTestPair(t)
+	defer dev1.Close()
+	defer dev2.Close()
+
+	ping := func(from, to *tuntest.ChannelTUN, dst, src string) {
+		t.Helper()
+		msg := tuntest.Ping(net.ParseIP(dst), net.ParseIP(src))
+		from.Outbound <- msg
+		select {
+		case msgRecv := <-to.Inbound:
+			if !bytes.Equal(msg, msgRecv) {
+				t.Fatal("ping did not transit correctly")
+			}
+		case <-time.After(300 * time.Millisecond):
+			t.Fatal("ping did not transit")
+		}
+	}
+
+	ping(tun2, tun1, "1.0.0.1", "1.0.0.2")
+	ping(tun1, tun2, "1.0.0.2", "1.0.0.1")
+
+	peer1 := dev1.LookupPeer(dev2.staticIdentity.publicKey)
+	handshakes := atomic.LoadUint64(&peer1.stats.handshakes)
+
+	// capture a transport message encrypted before the move, by briefly
+	// pointing dev2 at a socket of our own instead of dev1
+
+	dev1Addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(dev1.net.port)}
+	oldAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(dev2.net.port)}
+	capture, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assertNil(t, err)
+	peerCfg := "public_key=" + dev1.staticIdentity.publicKey.ToHex() + "\nendpoint="
+	ipcSet(t, dev2, peerCfg+capture.LocalAddr().String()+"\n")
+
+	late := tuntest.Ping(net.ParseIP("1.0.0.1"), net.ParseIP("1.0.0.2"))
+	tun2.Outbound <- late
+	captured := make([]byte, MaxMessageSize)
+	capture.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := capture.Read(captured)
+	assertNil(t, err)
+	capture.Close()
+	captured = captured[:n]
+	if binary.LittleEndian.Uint32(captured) != MessageTransportType {
+		t.Fatal("captured message is not a transport message")
+	}
+	ipcSet(t, dev2, peerCfg+dev1Addr.String()+"\n")
+
+	// move dev2 to a new port; dev1 must follow it by roaming
+
+	ipcSet(t, dev2, "listen_port="+getFreePort(t)+"\n")
+
+	for i := 0; i < 10; i++ {
+		ping(tun2, tun1, "1.0.0.1", "1.0.0.2")
+		ping(tun1, tun2, "1.0.0.2", "1.0.0.1")
+	}
+
+	// the captured message arrives late over the old path: it is
+	// accepted once and rejected when replayed
+
+	old, err := net.ListenUDP("udp4", oldAddr)
+	if err != nil {
+		t.Skip("old port was reused:", err)
+	}
+	defer old.Close()
+	for i := 0; i < 2; i++ {
+		_, err = old.WriteTo(captured, dev1Addr)
+		assertNil(t, err)
+		select {
+		case msgRecv := <-tun1.Inbound:
+			if i != 0 {
+				t.Fatal("replayed message was accepted")
+			}
+			if !bytes.Equal(late, msgRecv) {
+				t.Fatal("late message did not transit correctly")
+			}
+		case <-time.After(300 * time.Millisecond):
+			if i == 0 {
+				t.Fatal("late message from before the move was rejected")
+			}
+		}
+	}
+
+	// the late message roamed dev1 back to the old port, until dev2 speaks
+
+	ping(tun2, tun1, "1.0.0.1", "1.0.0.2")
+	ping(tun1, tun2, "1.0.0.2", "1.0.0.1")
+
+	if got := atomic.LoadUint64(&peer1.stats.handshakes); got != handshakes {
+		t.Errorf("session was renegotiated after roaming (%d handshakes, want %d)", got, handshakes)
+	}
+}
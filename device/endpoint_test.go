@@ -44,6 +44,10 @@ func (e *DummyEndpoint) SrcToBytes() []byte {
 	return e.src[:]
 }
 
+func (e *DummyEndpoint) DstToBytes() []byte {
+	return e.dst[:]
+}
+
 func (e *DummyEndpoint) DstIP() net.IP {
 	return e.dst[:]
 }
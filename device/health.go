@@ -0,0 +1,55 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"errors"
+	"time"
+)
+
+/* Reports whether the device is ready to carry traffic:
+ * it is up and the bind is listening
+ */
+func (device *Device) Health() error {
+	if device.isClosed.Get() {
+		return errors.New("device closed")
+	}
+	if !device.isUp.Get() {
+		return errors.New("device down")
+	}
+
+	device.net.RLock()
+	listening := device.net.bind != nil
+	device.net.RUnlock()
+	if !listening {
+		return errors.New("no bind")
+	}
+	return nil
+}
+
+/* Reports whether the device is healthy and at least one peer
+ * holds a session that has not yet expired.
+ *
+ * Handshakes only happen when there is traffic to send, so a server
+ * waiting for its first client, or an idle peer without persistent
+ * keepalives, fails this check while working as intended.
+ */
+func (device *Device) SessionHealth() error {
+	if err := device.Health(); err != nil {
+		return err
+	}
+
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+
+	for _, peer := range device.peers.keyMap {
+		keypair := peer.keypairs.Current()
+		if keypair != nil && keypair.created.Add(RejectAfterTime).After(time.Now()) {
+			return nil
+		}
+	}
+	return errors.New("no peer with a live session")
+}
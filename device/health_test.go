@@ -0,0 +1,85 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+func TestHealth(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	if device.Health() == nil {
+		t.Fatal("device reported healthy while down")
+	}
+
+	device.Up()
+	assertNil(t, device.Health())
+	if device.SessionHealth() == nil {
+		t.Fatal("device reported a live session without peers")
+	}
+
+	peer := randPeer(t, device)
+	if device.SessionHealth() == nil {
+		t.Fatal("device reported a live session before any handshake")
+	}
+
+	peer.keypairs.Lock()
+	peer.keypairs.current = &Keypair{created: time.Now()}
+	peer.keypairs.Unlock()
+	assertNil(t, device.SessionHealth())
+
+	peer.keypairs.Lock()
+	peer.keypairs.current.created = time.Now().Add(-RejectAfterTime)
+	peer.keypairs.Unlock()
+	if device.SessionHealth() == nil {
+		t.Fatal("device reported a live session after it expired")
+	}
+	assertNil(t, device.Health())
+
+	device.Down()
+	if device.SessionHealth() == nil {
+		t.Fatal("device reported a live session while down")
+	}
+}
+
+func TestIpcHealth(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	query := func(op string) string {
+		return strings.Join(ipcQuery(t, device, op), "\n")
+	}
+	unhealthy := func(reason string) string {
+		return fmt.Sprintf("error=%s\nerrno=%d", reason, ipc.IpcErrorIO)
+	}
+
+	if got, want := query("health=1"), unhealthy("device down"); got != want {
+		t.Fatalf("health of a down device = %q, want %q", got, want)
+	}
+
+	device.Up()
+	peer := randPeer(t, device)
+	if got := query("health=1"); got != "errno=0" {
+		t.Fatalf("health of an idle device = %q, want %q", got, "errno=0")
+	}
+	if got, want := query("health=session"), unhealthy("no peer with a live session"); got != want {
+		t.Fatalf("session health of an idle device = %q, want %q", got, want)
+	}
+
+	peer.keypairs.Lock()
+	peer.keypairs.current = &Keypair{created: time.Now()}
+	peer.keypairs.Unlock()
+	if got := query("health=session"); got != "errno=0" {
+		t.Fatalf("session health with a live session = %q, want %q", got, "errno=0")
+	}
+}
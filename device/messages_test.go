@@ -0,0 +1,114 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
+
+/* Pins the wire format of the handshake messages: any change to the
+ * field order or sizes of the message structs breaks compatibility
+ * with other WireGuard implementations and must show up here.
+ */
+func TestMessageWireFormat(t *testing.T) {
+	var initiation MessageInitiation
+	initiation.Type = MessageInitiationType
+	initiation.Sender = 0x11223344
+	fill(initiation.Ephemeral[:], 0xaa)
+	fill(initiation.Static[:], 0xbb)
+	fill(initiation.Timestamp[:], 0xcc)
+	fill(initiation.MAC1[:], 0xdd)
+	fill(initiation.MAC2[:], 0xee)
+
+	var response MessageResponse
+	response.Type = MessageResponseType
+	response.Sender = 0x11223344
+	response.Receiver = 0x55667788
+	fill(response.Ephemeral[:], 0xaa)
+	fill(response.Empty[:], 0xbb)
+	fill(response.MAC1[:], 0xdd)
+	fill(response.MAC2[:], 0xee)
+
+	var reply MessageCookieReply
+	reply.Type = MessageCookieReplyType
+	reply.Receiver = 0x55667788
+	fill(reply.Nonce[:], 0xaa)
+	fill(reply.Cookie[:], 0xbb)
+
+	golden := func(fields ...string) string {
+		return strings.Join(fields, "")
+	}
+	tests := []struct {
+		name   string
+		msg    interface{}
+		size   int
+		golden string
+	}{
+		{
+			name: "initiation",
+			msg:  &initiation,
+			size: MessageInitiationSize,
+			golden: golden(
+				"01000000",
+				"44332211",
+				strings.Repeat("aa", 32),
+				strings.Repeat("bb", 48),
+				strings.Repeat("cc", 28),
+				strings.Repeat("dd", 16),
+				strings.Repeat("ee", 16),
+			),
+		},
+		{
+			name: "response",
+			msg:  &response,
+			size: MessageResponseSize,
+			golden: golden(
+				"02000000",
+				"44332211",
+				"88776655",
+				strings.Repeat("aa", 32),
+				strings.Repeat("bb", 16),
+				strings.Repeat("dd", 16),
+				strings.Repeat("ee", 16),
+			),
+		},
+		{
+			name: "cookie reply",
+			msg:  &reply,
+			size: MessageCookieReplySize,
+			golden: golden(
+				"03000000",
+				"88776655",
+				strings.Repeat("aa", 24),
+				strings.Repeat("bb", 32),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := binary.Write(&buf, binary.LittleEndian, tt.msg)
+			assertNil(t, err)
+			if buf.Len() != tt.size {
+				t.Fatalf("encoded %d bytes, want %d", buf.Len(), tt.size)
+			}
+			if got := hex.EncodeToString(buf.Bytes()); got != tt.golden {
+				t.Fatalf("wire format changed:\n got %s\nwant %s", got, tt.golden)
+			}
+		})
+	}
+}
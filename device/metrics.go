@@ -0,0 +1,93 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value func(stats *PeerStats) float64
+}
+
+var peerMetrics = []metric{
+	{
+		name: "wireguard_peer_transmit_bytes_total",
+		help: "Bytes sent to the peer.",
+		kind: "counter",
+		value: func(stats *PeerStats) float64 {
+			return float64(stats.TxBytes)
+		},
+	},
+	{
+		name: "wireguard_peer_receive_bytes_total",
+		help: "Bytes received from the peer.",
+		kind: "counter",
+		value: func(stats *PeerStats) float64 {
+			return float64(stats.RxBytes)
+		},
+	},
+	{
+		name: "wireguard_peer_transmit_packets_total",
+		help: "Packets sent to the peer.",
+		kind: "counter",
+		value: func(stats *PeerStats) float64 {
+			return float64(stats.TxPackets)
+		},
+	},
+	{
+		name: "wireguard_peer_receive_packets_total",
+		help: "Packets received from the peer.",
+		kind: "counter",
+		value: func(stats *PeerStats) float64 {
+			return float64(stats.RxPackets)
+		},
+	},
+	{
+		name: "wireguard_peer_handshakes_total",
+		help: "Completed handshakes with the peer.",
+		kind: "counter",
+		value: func(stats *PeerStats) float64 {
+			return float64(stats.Handshakes)
+		},
+	},
+	{
+		name: "wireguard_peer_last_handshake_seconds",
+		help: "UNIX time of the last completed handshake with the peer.",
+		kind: "gauge",
+		value: func(stats *PeerStats) float64 {
+			if stats.LastHandshake.IsZero() {
+				return 0
+			}
+			return float64(stats.LastHandshake.UnixNano()) / 1e9
+		},
+	},
+}
+
+/* Writes the per-peer counters of the device
+ * in the Prometheus text exposition format
+ */
+func (device *Device) WriteMetrics(w io.Writer) error {
+	stats := device.Stats()
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range peerMetrics {
+		fmt.Fprintf(buffered, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(buffered, "# TYPE %s %s\n", m.name, m.kind)
+		for i := range stats.Peers {
+			peer := &stats.Peers[i]
+			value := strconv.FormatFloat(m.value(peer), 'f', -1, 64)
+			fmt.Fprintf(buffered, "%s{public_key=%q} %s\n", m.name, peer.PublicKey, value)
+		}
+	}
+	return buffered.Flush()
+}
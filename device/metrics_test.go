@@ -0,0 +1,40 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	peer := randPeer(t, device)
+	pk := peer.handshake.remoteStatic
+	atomic.AddUint64(&peer.stats.txBytes, 1337)
+	atomic.AddUint64(&peer.stats.handshakes, 2)
+
+	var buf bytes.Buffer
+	assertNil(t, device.WriteMetrics(&buf))
+	out := buf.String()
+
+	key := base64.StdEncoding.EncodeToString(pk[:])
+	for _, want := range []string{
+		"# TYPE wireguard_peer_transmit_bytes_total counter\n",
+		"wireguard_peer_transmit_bytes_total{public_key=\"" + key + "\"} 1337\n",
+		"wireguard_peer_handshakes_total{public_key=\"" + key + "\"} 2\n",
+		"wireguard_peer_last_handshake_seconds{public_key=\"" + key + "\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output is missing %q:\n%s", want, out)
+		}
+	}
+}
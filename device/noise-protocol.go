@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/blake2s"
@@ -128,7 +129,8 @@ type Handshake struct {
 	remoteStatic              NoisePublicKey           // long term key
 	remoteEphemeral           NoisePublicKey           // ephemeral public key
 	precomputedStaticStatic   [NoisePublicKeySize]byte // precomputed shared secret
-	lastTimestamp             tai64n.Timestamp
+	lastTimestamp             tai64n.Timestamp         // highest timestamp accepted
+	lastToleratedTimestamp    tai64n.Timestamp         // last timestamp accepted below lastTimestamp
 	lastInitiationConsumption time.Time
 	lastSentHandshake         time.Time
 }
@@ -247,6 +249,31 @@ func (device *Device) CreateMessageInitiation(peer *Peer) (*MessageInitiation, e
 	return &msg, nil
 }
 
+/* Allows the TAI64N timestamp of a handshake initiation to fall behind
+ * the highest one accepted from the same peer by up to tolerance, so that
+ * peers whose clocks are stepped backwards (e.g. badly synchronised VMs)
+ * can still reconnect without a restart.
+ *
+ * The highest timestamp is never lowered, and timestamps accepted below it
+ * must themselves keep increasing. Hence every initiation is accepted at
+ * most once, but a captured initiation that has not been superseded may
+ * still be replayed within the window, so the tolerance defaults to zero.
+ */
+func (device *Device) SetHandshakeTimestampTolerance(tolerance time.Duration) {
+	if tolerance < 0 {
+		tolerance = 0
+	}
+	atomic.StoreInt64(&device.handshakeTimestampTolerance, int64(tolerance))
+}
+
+func (device *Device) toleratesTimestamp(timestamp tai64n.Timestamp, handshake *Handshake) bool {
+	tolerance := time.Duration(atomic.LoadInt64(&device.handshakeTimestampTolerance))
+	if tolerance == 0 || timestamp == handshake.lastTimestamp || !timestamp.After(handshake.lastToleratedTimestamp) {
+		return false
+	}
+	return timestamp.After(handshake.lastTimestamp.Add(-tolerance))
+}
+
 func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	var (
 		hash     [blake2s.Size]byte
@@ -316,6 +343,10 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	// protect against replay & flood
 
 	replay := !timestamp.After(handshake.lastTimestamp)
+	regressed := replay && device.toleratesTimestamp(timestamp, handshake)
+	if regressed {
+		replay = false
+	}
 	flood := time.Since(handshake.lastInitiationConsumption) <= HandshakeInitationRate
 	handshake.mutex.RUnlock()
 	if replay {
@@ -326,6 +357,9 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 		device.log.Debug.Printf("%v - ConsumeMessageInitiation: handshake flood\n", peer)
 		return nil
 	}
+	if regressed {
+		device.log.Info.Printf("%v - ConsumeMessageInitiation: accepting handshake timestamp regression @ %v\n", peer, timestamp)
+	}
 
 	// update handshake state
 
@@ -337,6 +371,8 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	handshake.remoteEphemeral = msg.Ephemeral
 	if timestamp.After(handshake.lastTimestamp) {
 		handshake.lastTimestamp = timestamp
+	} else if regressed && timestamp.After(handshake.lastToleratedTimestamp) {
+		handshake.lastToleratedTimestamp = timestamp
 	}
 	now := time.Now()
 	if now.After(handshake.lastInitiationConsumption) {
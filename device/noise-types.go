@@ -89,3 +89,7 @@ func (key *NoiseSymmetricKey) FromHex(src string) error {
 func (key NoiseSymmetricKey) ToHex() string {
 	return hex.EncodeToString(key[:])
 }
+
+func (key NoiseSymmetricKey) Equals(tar NoiseSymmetricKey) bool {
+	return subtle.ConstantTimeCompare(key[:], tar[:]) == 1
+}
@@ -9,6 +9,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tai64n"
 )
 
 func TestCurveWrappers(t *testing.T) {
@@ -142,3 +145,65 @@ func TestNoiseHandshake(t *testing.T) {
 		assertEqual(t, out, testMsg)
 	}()
 }
+
+func TestHandshakeTimestampTolerance(t *testing.T) {
+	dev1 := randDevice(t)
+	dev2 := randDevice(t)
+
+	defer dev1.Close()
+	defer dev2.Close()
+
+	peer1, _ := dev2.NewPeer(dev1.staticIdentity.privateKey.publicKey())
+	peer2, _ := dev1.NewPeer(dev2.staticIdentity.privateKey.publicKey())
+
+	// pretend that dev1's clock has been stepped back by a minute
+
+	highWater := tai64n.Now().Add(time.Minute)
+	peer1.handshake.lastTimestamp = highWater
+
+	initiate := func() *MessageInitiation {
+		msg, err := dev1.CreateMessageInitiation(peer2)
+		assertNil(t, err)
+		time.Sleep(20 * time.Millisecond) // exceed the timestamp granularity
+		return msg
+	}
+	consume := func(msg *MessageInitiation) bool {
+		peer1.handshake.mutex.Lock()
+		peer1.handshake.lastInitiationConsumption = time.Time{}
+		peer1.handshake.mutex.Unlock()
+		return dev2.ConsumeMessageInitiation(msg) != nil
+	}
+
+	older, newer := initiate(), initiate()
+	if consume(older) {
+		t.Fatal("regressed timestamp accepted without tolerance")
+	}
+
+	dev2.SetHandshakeTimestampTolerance(2 * time.Minute)
+	if !consume(older) {
+		t.Fatal("regressed timestamp rejected within tolerance")
+	}
+	if !consume(newer) {
+		t.Fatal("advancing regressed timestamp rejected within tolerance")
+	}
+
+	// alternating captured initiations must not be accepted again
+
+	if consume(older) {
+		t.Fatal("replay of older initiation accepted")
+	}
+	if consume(newer) {
+		t.Fatal("replay of newer initiation accepted")
+	}
+	if peer1.handshake.lastTimestamp != highWater {
+		t.Fatal("tolerated timestamp lowered the high-water mark")
+	}
+	if !consume(initiate()) {
+		t.Fatal("fresh initiation rejected within tolerance")
+	}
+
+	dev2.SetHandshakeTimestampTolerance(30 * time.Second)
+	if consume(initiate()) {
+		t.Fatal("regressed timestamp accepted beyond tolerance")
+	}
+}
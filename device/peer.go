@@ -6,6 +6,7 @@
 package device
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -21,15 +22,6 @@ const (
 )
 
 type Peer struct {
-	isRunning                   AtomicBool
-	sync.RWMutex                // Mostly protects endpoint, but is generally taken whenever we modify peer
-	keypairs                    Keypairs
-	handshake                   Handshake
-	device                      *Device
-	endpoint                    conn.Endpoint
-	persistentKeepaliveInterval uint16
-	disableRoaming              bool
-
 	// These fields are accessed with atomic operations, which must be
 	// 64-bit aligned even on 32-bit platforms. Go guarantees that an
 	// allocated struct will be 64-bit aligned. So we place
@@ -38,9 +30,21 @@ type Peer struct {
 	stats struct {
 		txBytes           uint64 // bytes send to peer (endpoint)
 		rxBytes           uint64 // bytes received from peer
+		txPackets         uint64 // packets send to peer (endpoint)
+		rxPackets         uint64 // packets received from peer
+		handshakes        uint64 // completed handshakes
 		lastHandshakeNano int64  // nano seconds since epoch
 	}
 
+	isRunning                   AtomicBool
+	sync.RWMutex                // Mostly protects endpoint, but is generally taken whenever we modify peer
+	keypairs                    Keypairs
+	handshake                   Handshake
+	device                      *Device
+	endpoint                    conn.Endpoint
+	persistentKeepaliveInterval uint16
+	disableRoaming              bool
+
 	timers struct {
 		retransmitHandshake     *Timer
 		sendKeepalive           *Timer
@@ -88,6 +92,14 @@ func (device *Device) NewPeer(pk NoisePublicKey) (*Peer, error) {
 	device.peers.Lock()
 	defer device.peers.Unlock()
 
+	return unsafeNewPeer(device, pk)
+}
+
+/* Requires the static identity to be read locked
+ * and the peer map to be locked
+ */
+func unsafeNewPeer(device *Device, pk NoisePublicKey) (*Peer, error) {
+
 	// check if over limit
 
 	if len(device.peers.keyMap) >= MaxPeers {
@@ -154,6 +166,7 @@ func (peer *Peer) SendBuffer(buffer []byte) error {
 	err := peer.device.net.bind.Send(buffer, peer.endpoint)
 	if err == nil {
 		atomic.AddUint64(&peer.stats.txBytes, uint64(len(buffer)))
+		atomic.AddUint64(&peer.stats.txPackets, 1)
 	}
 	return err
 }
@@ -299,7 +312,12 @@ func (peer *Peer) SetEndpointFromPacket(endpoint conn.Endpoint) {
 	if peer.disableRoaming {
 		return
 	}
+	sink := peer.device.telemetrySink()
 	peer.Lock()
+	changed := sink != nil && (peer.endpoint == nil || !bytes.Equal(peer.endpoint.DstToBytes(), endpoint.DstToBytes()))
 	peer.endpoint = endpoint
 	peer.Unlock()
+	if changed {
+		sink.OnEndpointChange(peer.handshake.remoteStatic, endpoint)
+	}
 }
@@ -56,7 +56,7 @@ func (elem *QueueInboundElement) IsDropped() bool {
 	return atomic.LoadInt32(&elem.dropped) == AtomicTrue
 }
 
-func (device *Device) addToInboundAndDecryptionQueues(inboundQueue chan *QueueInboundElement, decryptionQueue chan *QueueInboundElement, element *QueueInboundElement) bool {
+func (device *Device) addToInboundAndDecryptionQueues(peer *Peer, inboundQueue chan *QueueInboundElement, decryptionQueue chan *QueueInboundElement, element *QueueInboundElement) bool {
 	select {
 	case inboundQueue <- element:
 		select {
@@ -65,10 +65,13 @@ func (device *Device) addToInboundAndDecryptionQueues(inboundQueue chan *QueueIn
 		default:
 			element.Drop()
 			element.Unlock()
+			device.countReceiveError(receiveErrorDecryptionQueueFull)
 			return false
 		}
 	default:
+		peer.reportDrop(DropReasonQueueFull)
 		device.PutInboundElement(element)
+		device.countReceiveError(receiveErrorInboundQueueFull)
 		return false
 	}
 }
@@ -142,6 +145,7 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 		}
 
 		if size < MinMessageSize {
+			device.countReceiveError(receiveErrorInvalidSize)
 			continue
 		}
 
@@ -161,6 +165,7 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 			// check size
 
 			if len(packet) < MessageTransportSize {
+				device.countReceiveError(receiveErrorInvalidSize)
 				continue
 			}
 
@@ -172,12 +177,14 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 			value := device.indexTable.Lookup(receiver)
 			keypair := value.keypair
 			if keypair == nil {
+				device.countReceiveError(receiveErrorUnknownReceiver)
 				continue
 			}
 
 			// check keypair expiry
 
 			if keypair.created.Add(RejectAfterTime).Before(time.Now()) {
+				device.countReceiveError(receiveErrorExpiredKeypair)
 				continue
 			}
 
@@ -197,7 +204,7 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 
 			peer.queue.RLock()
 			if peer.isRunning.Get() {
-				if device.addToInboundAndDecryptionQueues(peer.queue.inbound, device.queue.decryption, elem) {
+				if device.addToInboundAndDecryptionQueues(peer, peer.queue.inbound, device.queue.decryption, elem) {
 					buffer = device.GetMessageBuffer()
 				}
 			}
@@ -217,21 +224,27 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 			okay = len(packet) == MessageCookieReplySize
 
 		default:
-			logDebug.Println("Received message with unknown type")
+			device.countReceiveError(receiveErrorUnknownType)
+			continue
 		}
 
-		if okay {
-			if (device.addToHandshakeQueue(
-				device.queue.handshake,
-				QueueHandshakeElement{
-					msgType:  msgType,
-					buffer:   buffer,
-					packet:   packet,
-					endpoint: endpoint,
-				},
-			)) {
-				buffer = device.GetMessageBuffer()
-			}
+		if !okay {
+			device.countReceiveError(receiveErrorInvalidSize)
+			continue
+		}
+
+		if (device.addToHandshakeQueue(
+			device.queue.handshake,
+			QueueHandshakeElement{
+				msgType:  msgType,
+				buffer:   buffer,
+				packet:   packet,
+				endpoint: endpoint,
+			},
+		)) {
+			buffer = device.GetMessageBuffer()
+		} else {
+			device.countReceiveError(receiveErrorHandshakeQueueFull)
 		}
 	}
 }
@@ -442,6 +455,7 @@ func (device *Device) RoutineHandshake() {
 
 			logDebug.Println(peer, "- Received handshake initiation")
 			atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)))
+			atomic.AddUint64(&peer.stats.rxPackets, 1)
 
 			peer.SendHandshakeResponse()
 
@@ -473,6 +487,7 @@ func (device *Device) RoutineHandshake() {
 
 			logDebug.Println(peer, "- Received handshake response")
 			atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)))
+			atomic.AddUint64(&peer.stats.rxPackets, 1)
 
 			// update timers
 
@@ -547,12 +562,14 @@ func (peer *Peer) RoutineSequentialReceiver() {
 		elem.Lock()
 
 		if elem.IsDropped() {
+			peer.reportDrop(DropReasonDecryption)
 			continue
 		}
 
 		// check for replay
 
 		if !elem.keypair.replayFilter.ValidateCounter(elem.counter, RejectAfterMessages) {
+			peer.reportDrop(DropReasonReplay)
 			continue
 		}
 
@@ -572,6 +589,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 		peer.timersAnyAuthenticatedPacketTraversal()
 		peer.timersAnyAuthenticatedPacketReceived()
 		atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)+MinMessageSize))
+		atomic.AddUint64(&peer.stats.rxPackets, 1)
 
 		// check for keepalive
 
@@ -589,12 +607,14 @@ func (peer *Peer) RoutineSequentialReceiver() {
 			// strip padding
 
 			if len(elem.packet) < ipv4.HeaderLen {
+				peer.reportDrop(DropReasonMalformed)
 				continue
 			}
 
 			field := elem.packet[IPv4offsetTotalLength : IPv4offsetTotalLength+2]
 			length := binary.BigEndian.Uint16(field)
 			if int(length) > len(elem.packet) || int(length) < ipv4.HeaderLen {
+				peer.reportDrop(DropReasonMalformed)
 				continue
 			}
 
@@ -608,6 +628,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 					"IPv4 packet with disallowed source address from",
 					peer,
 				)
+				peer.reportDrop(DropReasonDisallowedSource)
 				continue
 			}
 
@@ -616,6 +637,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 			// strip padding
 
 			if len(elem.packet) < ipv6.HeaderLen {
+				peer.reportDrop(DropReasonMalformed)
 				continue
 			}
 
@@ -623,6 +645,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 			length := binary.BigEndian.Uint16(field)
 			length += ipv6.HeaderLen
 			if int(length) > len(elem.packet) {
+				peer.reportDrop(DropReasonMalformed)
 				continue
 			}
 
@@ -636,11 +659,13 @@ func (peer *Peer) RoutineSequentialReceiver() {
 					"IPv6 packet with disallowed source address from",
 					peer,
 				)
+				peer.reportDrop(DropReasonDisallowedSource)
 				continue
 			}
 
 		default:
 			logInfo.Println("Packet with invalid IP version from", peer)
+			peer.reportDrop(DropReasonMalformed)
 			continue
 		}
 
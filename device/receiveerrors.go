@@ -0,0 +1,72 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* Invalid or undeliverable datagrams are counted per class
+ * and summarised in the log at most once per ReceiveErrorLogInterval,
+ * so that a flood of garbage cannot flood the log.
+ *
+ * A datagram dropped because the decryption queue is full has already
+ * been placed on the peer's inbound queue, so it is also reported to the
+ * telemetry sink as DropReasonDecryption by the sequential receiver.
+ */
+
+type receiveError int
+
+const (
+	receiveErrorInvalidSize receiveError = iota
+	receiveErrorUnknownType
+	receiveErrorUnknownReceiver
+	receiveErrorExpiredKeypair
+	receiveErrorInboundQueueFull
+	receiveErrorDecryptionQueueFull
+	receiveErrorHandshakeQueueFull
+	receiveErrorCount
+)
+
+var receiveErrorNames = [receiveErrorCount]string{
+	receiveErrorInvalidSize:         "invalid size",
+	receiveErrorUnknownType:         "unknown type",
+	receiveErrorUnknownReceiver:     "unknown receiver",
+	receiveErrorExpiredKeypair:      "expired keypair",
+	receiveErrorInboundQueueFull:    "inbound queue full",
+	receiveErrorDecryptionQueueFull: "decryption queue full",
+	receiveErrorHandshakeQueueFull:  "handshake queue full",
+}
+
+type receiveErrors struct {
+	pending AtomicBool
+	counts  [receiveErrorCount]uint32
+}
+
+func (device *Device) countReceiveError(class receiveError) {
+	atomic.AddUint32(&device.receiveErrors.counts[class], 1)
+	if !device.receiveErrors.pending.Swap(true) {
+		time.AfterFunc(ReceiveErrorLogInterval, device.logReceiveErrors)
+	}
+}
+
+func (device *Device) logReceiveErrors() {
+	device.receiveErrors.pending.Set(false)
+
+	var summary []string
+	for class := range device.receiveErrors.counts {
+		n := atomic.SwapUint32(&device.receiveErrors.counts[class], 0)
+		if n != 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", n, receiveErrorNames[class]))
+		}
+	}
+	if len(summary) != 0 {
+		device.log.Info.Printf("Dropped received datagrams in the last %v: %s\n", ReceiveErrorLogInterval, strings.Join(summary, ", "))
+	}
+}
@@ -0,0 +1,78 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReceiveErrorSummary(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	var buf bytes.Buffer
+	device.log.Info = log.New(&buf, "", 0)
+
+	device.countReceiveError(receiveErrorUnknownType)
+	device.countReceiveError(receiveErrorUnknownType)
+	device.countReceiveError(receiveErrorExpiredKeypair)
+	if !device.receiveErrors.pending.Get() {
+		t.Fatal("no summary scheduled after receive errors")
+	}
+
+	device.logReceiveErrors()
+	out := buf.String()
+	if !strings.Contains(out, "2 unknown type") || !strings.Contains(out, "1 expired keypair") {
+		t.Fatalf("unexpected summary: %q", out)
+	}
+	if strings.Contains(out, "invalid size") {
+		t.Fatalf("summary contains classes without errors: %q", out)
+	}
+
+	buf.Reset()
+	device.logReceiveErrors()
+	if buf.Len() != 0 {
+		t.Fatalf("empty summary was logged: %q", buf.String())
+	}
+}
+
+func TestReceiveErrorQueueFullClasses(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	peer := randPeer(t, device)
+	sink := new(recordingSink)
+	device.SetTelemetrySink(sink)
+
+	enqueue := func(inbound, decryption chan *QueueInboundElement) {
+		elem := device.GetInboundElement()
+		elem.Mutex = sync.Mutex{}
+		elem.Lock()
+		if device.addToInboundAndDecryptionQueues(peer, inbound, decryption, elem) {
+			t.Fatal("element queued despite full queue")
+		}
+	}
+
+	enqueue(make(chan *QueueInboundElement), make(chan *QueueInboundElement, 1))
+	enqueue(make(chan *QueueInboundElement, 1), make(chan *QueueInboundElement))
+	enqueue(make(chan *QueueInboundElement, 1), make(chan *QueueInboundElement))
+
+	counts := &device.receiveErrors.counts
+	if counts[receiveErrorInboundQueueFull] != 1 || counts[receiveErrorDecryptionQueueFull] != 2 {
+		t.Fatalf("inbound queue full = %d, decryption queue full = %d; want 1 and 2",
+			counts[receiveErrorInboundQueueFull], counts[receiveErrorDecryptionQueueFull])
+	}
+
+	// decryption queue overflows are reported later, by the sequential receiver
+
+	if len(sink.drops) != 1 || sink.drops[0] != DropReasonQueueFull {
+		t.Fatalf("drops = %v, want [queue-full]", sink.drops)
+	}
+}
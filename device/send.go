@@ -109,6 +109,7 @@ func addToOutboundAndEncryptionQueues(outboundQueue chan *QueueOutboundElement,
 			element.Unlock()
 		}
 	default:
+		element.peer.reportDrop(DropReasonQueueFull)
 		element.peer.device.PutMessageBuffer(element.buffer)
 		element.peer.device.PutOutboundElement(element)
 	}
@@ -613,6 +614,7 @@ func (peer *Peer) RoutineSequentialSender() {
 			elem.Lock()
 			if elem.IsDropped() {
 				device.PutOutboundElement(elem)
+				peer.reportDrop(DropReasonQueueFull)
 				continue
 			}
 
@@ -629,6 +631,7 @@ func (peer *Peer) RoutineSequentialSender() {
 			device.PutOutboundElement(elem)
 			if err != nil {
 				logError.Println(peer, "- Failed to send data packet", err)
+				peer.reportDrop(DropReasonSendFailed)
 				continue
 			}
 
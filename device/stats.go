@@ -0,0 +1,84 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"encoding/base64"
+	"sync/atomic"
+	"time"
+)
+
+type PeerStats struct {
+	PublicKey                   string    `json:"public_key"`
+	Endpoint                    string    `json:"endpoint,omitempty"`
+	AllowedIPs                  []string  `json:"allowed_ips"`
+	PersistentKeepaliveInterval uint16    `json:"persistent_keepalive_interval"`
+	TxBytes                     uint64    `json:"tx_bytes"`
+	RxBytes                     uint64    `json:"rx_bytes"`
+	TxPackets                   uint64    `json:"tx_packets"`
+	RxPackets                   uint64    `json:"rx_packets"`
+	Handshakes                  uint64    `json:"handshakes"`
+	LastHandshake               time.Time `json:"last_handshake"`
+}
+
+type DeviceStats struct {
+	PublicKey  string      `json:"public_key,omitempty"`
+	ListenPort uint16      `json:"listen_port"`
+	Fwmark     uint32      `json:"fwmark"`
+	Up         bool        `json:"up"`
+	Peers      []PeerStats `json:"peers"`
+}
+
+/* Returns a consistent snapshot of the device and peer statistics
+ */
+func (device *Device) Stats() DeviceStats {
+	var stats DeviceStats
+
+	device.net.RLock()
+	defer device.net.RUnlock()
+
+	device.staticIdentity.RLock()
+	defer device.staticIdentity.RUnlock()
+
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+
+	if !device.staticIdentity.privateKey.IsZero() {
+		stats.PublicKey = base64.StdEncoding.EncodeToString(device.staticIdentity.publicKey[:])
+	}
+	stats.ListenPort = device.net.port
+	stats.Fwmark = device.net.fwmark
+	stats.Up = device.isUp.Get()
+	stats.Peers = make([]PeerStats, 0, len(device.peers.keyMap))
+
+	for key, peer := range device.peers.keyMap {
+		peer.RLock()
+		ps := PeerStats{
+			PublicKey:                   base64.StdEncoding.EncodeToString(key[:]),
+			AllowedIPs:                  []string{},
+			PersistentKeepaliveInterval: peer.persistentKeepaliveInterval,
+			TxBytes:                     atomic.LoadUint64(&peer.stats.txBytes),
+			RxBytes:                     atomic.LoadUint64(&peer.stats.rxBytes),
+			TxPackets:                   atomic.LoadUint64(&peer.stats.txPackets),
+			RxPackets:                   atomic.LoadUint64(&peer.stats.rxPackets),
+			Handshakes:                  atomic.LoadUint64(&peer.stats.handshakes),
+		}
+		if peer.endpoint != nil {
+			ps.Endpoint = peer.endpoint.DstToString()
+		}
+		peer.RUnlock()
+
+		if nano := atomic.LoadInt64(&peer.stats.lastHandshakeNano); nano != 0 {
+			ps.LastHandshake = time.Unix(0, nano)
+		}
+		for _, ip := range device.allowedips.EntriesForPeer(peer) {
+			ps.AllowedIPs = append(ps.AllowedIPs, ip.String())
+		}
+		stats.Peers = append(stats.Peers, ps)
+	}
+
+	return stats
+}
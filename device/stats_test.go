@@ -0,0 +1,30 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestIpcStats(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	pk := randPeer(t, device).handshake.remoteStatic
+
+	lines := ipcQuery(t, device, "stats=1")
+	if len(lines) != 2 || lines[1] != "errno=0" {
+		t.Fatalf("unexpected response %q", lines)
+	}
+
+	var stats DeviceStats
+	assertNil(t, json.Unmarshal([]byte(lines[0]), &stats))
+	if len(stats.Peers) != 1 || stats.Peers[0].PublicKey != base64.StdEncoding.EncodeToString(pk[:]) {
+		t.Fatalf("unexpected peers in stats: %+v", stats.Peers)
+	}
+}
@@ -36,6 +36,7 @@ func (device *Device) startRouteListener(bind conn.Bind) (*rwcancel.RWCancel, er
 		return nil, err
 	}
 
+	device.net.stopping.Add(1)
 	go device.routineRouteListener(bind, netlinkSock, netlinkCancel)
 
 	return netlinkCancel, nil
@@ -49,6 +50,8 @@ func (device *Device) routineRouteListener(bind conn.Bind, netlinkSock int, netl
 	var reqPeer map[uint32]peerEndpointPtr
 	var reqPeerLock sync.Mutex
 
+	defer device.net.stopping.Done()
+	defer netlinkCancel.Close()
 	defer unix.Close(netlinkSock)
 
 	for msg := make([]byte, 1<<16); ; {
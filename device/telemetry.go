@@ -0,0 +1,75 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+type DropReason int
+
+const (
+	DropReasonDecryption       DropReason = iota // failed authentication or decryption queue full
+	DropReasonReplay                             // counter rejected by replay filter
+	DropReasonDisallowedSource                   // inner source address not in allowed ips
+	DropReasonMalformed                          // invalid inner packet
+	DropReasonQueueFull                          // encryption, outbound or inbound queue full
+	DropReasonSendFailed                         // bind failed to send
+)
+
+func (reason DropReason) String() string {
+	switch reason {
+	case DropReasonDecryption:
+		return "decryption"
+	case DropReasonReplay:
+		return "replay"
+	case DropReasonDisallowedSource:
+		return "disallowed-source"
+	case DropReasonMalformed:
+		return "malformed"
+	case DropReasonQueueFull:
+		return "queue-full"
+	case DropReasonSendFailed:
+		return "send-failed"
+	}
+	return "unknown"
+}
+
+// A TelemetrySink receives measurement events from a Device.
+//
+// Methods are called synchronously from the packet processing
+// routines and must therefore not block.
+type TelemetrySink interface {
+	// OnHandshake is called when a handshake with the peer completes.
+	OnHandshake(peer NoisePublicKey)
+
+	// OnEndpointChange is called when the endpoint of the peer
+	// is updated from an authenticated packet (roaming).
+	OnEndpointChange(peer NoisePublicKey, endpoint conn.Endpoint)
+
+	// OnPacketDrop is called when a packet to or from the peer is dropped.
+	OnPacketDrop(peer NoisePublicKey, reason DropReason)
+}
+
+type telemetryHolder struct {
+	sink TelemetrySink
+}
+
+// SetTelemetrySink installs sink as the receiver of measurement events,
+// replacing any previous sink. A nil sink disables telemetry.
+func (device *Device) SetTelemetrySink(sink TelemetrySink) {
+	device.telemetry.Store(telemetryHolder{sink})
+}
+
+func (device *Device) telemetrySink() TelemetrySink {
+	return device.telemetry.Load().(telemetryHolder).sink
+}
+
+func (peer *Peer) reportDrop(reason DropReason) {
+	if sink := peer.device.telemetrySink(); sink != nil {
+		sink.OnPacketDrop(peer.handshake.remoteStatic, reason)
+	}
+}
@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+type recordingSink struct {
+	handshakes      int
+	endpointChanges int
+	drops           []DropReason
+}
+
+func (s *recordingSink) OnHandshake(peer NoisePublicKey) {
+	s.handshakes++
+}
+
+func (s *recordingSink) OnEndpointChange(peer NoisePublicKey, endpoint conn.Endpoint) {
+	s.endpointChanges++
+}
+
+func (s *recordingSink) OnPacketDrop(peer NoisePublicKey, reason DropReason) {
+	s.drops = append(s.drops, reason)
+}
+
+func TestTelemetrySink(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	peer := randPeer(t, device)
+
+	// events without a sink are discarded
+
+	peer.timersHandshakeComplete()
+	peer.reportDrop(DropReasonReplay)
+
+	sink := new(recordingSink)
+	device.SetTelemetrySink(sink)
+
+	peer.timersHandshakeComplete()
+	if sink.handshakes != 1 {
+		t.Errorf("handshakes = %d, want 1", sink.handshakes)
+	}
+
+	endpoint, err := CreateDummyEndpoint()
+	assertNil(t, err)
+	peer.SetEndpointFromPacket(endpoint)
+	peer.SetEndpointFromPacket(endpoint)
+	other, err := CreateDummyEndpoint()
+	assertNil(t, err)
+	peer.SetEndpointFromPacket(other)
+	if sink.endpointChanges != 2 {
+		t.Errorf("endpoint changes = %d, want 2", sink.endpointChanges)
+	}
+
+	peer.reportDrop(DropReasonReplay)
+	if len(sink.drops) != 1 || sink.drops[0] != DropReasonReplay {
+		t.Errorf("drops = %v, want [replay]", sink.drops)
+	}
+
+	device.SetTelemetrySink(nil)
+	peer.timersHandshakeComplete()
+	if sink.handshakes != 1 {
+		t.Errorf("handshakes = %d after removing sink, want 1", sink.handshakes)
+	}
+}
+
+func TestTelemetryOutboundQueueFull(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	peer := randPeer(t, device)
+	sink := new(recordingSink)
+	device.SetTelemetrySink(sink)
+
+	elem := device.NewOutboundElement()
+	elem.peer = peer
+	elem.Lock()
+	addToOutboundAndEncryptionQueues(make(chan *QueueOutboundElement), make(chan *QueueOutboundElement, 1), elem)
+
+	if len(sink.drops) != 1 || sink.drops[0] != DropReasonQueueFull {
+		t.Fatalf("drops = %v, want [queue-full]", sink.drops)
+	}
+}
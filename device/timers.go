@@ -191,6 +191,10 @@ func (peer *Peer) timersHandshakeComplete() {
 	atomic.StoreUint32(&peer.timers.handshakeAttempts, 0)
 	peer.timers.sentLastMinuteHandshake.Set(false)
 	atomic.StoreInt64(&peer.stats.lastHandshakeNano, time.Now().UnixNano())
+	atomic.AddUint64(&peer.stats.handshakes, 1)
+	if sink := peer.device.telemetrySink(); sink != nil {
+		sink.OnHandshake(peer.handshake.remoteStatic)
+	}
 }
 
 /* Should be called after an ephemeral key is created, which is before sending a handshake response or after receiving a handshake response. */
@@ -7,6 +7,7 @@ package device
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -118,13 +119,15 @@ func (device *Device) IpcSetOperation(socket *bufio.Reader) error {
 	createdNewPeer := false
 	deviceConfig := true
 
+	replacePeers := false
+
 	for scanner.Scan() {
 
 		// parse line
 
 		line := scanner.Text()
 		if line == "" {
-			return nil
+			break
 		}
 		parts := strings.Split(line, "=")
 		if len(parts) != 2 {
@@ -196,6 +199,14 @@ func (device *Device) IpcSetOperation(socket *bufio.Reader) error {
 				}
 
 			case "public_key":
+				if replacePeers {
+					peers, err := device.ipcParsePeers(value, scanner)
+					if err != nil {
+						return err
+					}
+					return device.replacePeers(peers)
+				}
+
 				// switch to peer configuration
 				logDebug.Println("UAPI: Transition to peer configuration")
 				deviceConfig = false
@@ -205,8 +216,7 @@ func (device *Device) IpcSetOperation(socket *bufio.Reader) error {
 					logError.Println("Failed to set replace_peers, invalid value:", value)
 					return &IPCError{ipc.IpcErrorInvalid}
 				}
-				logDebug.Println("UAPI: Removing all peers")
-				device.RemoveAllPeers()
+				replacePeers = true
 
 			default:
 				logError.Println("Invalid UAPI device key:", key)
@@ -394,6 +404,231 @@ func (device *Device) IpcSetOperation(socket *bufio.Reader) error {
 		}
 	}
 
+	if replacePeers {
+		return device.replacePeers(nil)
+	}
+
+	return nil
+}
+
+/* A peer of a replace_peers operation, staged so that the whole peer set
+ * can be validated before any of it is applied
+ */
+type ipcPeerConfig struct {
+	updateOnly   bool
+	presharedKey NoiseSymmetricKey
+	endpoint     conn.Endpoint
+	keepalive    uint16
+	allowedIPs   []*net.IPNet
+}
+
+func (device *Device) ipcParsePeers(publicKey string, scanner *bufio.Scanner) (map[NoisePublicKey]*ipcPeerConfig, error) {
+	logError := device.log.Error
+
+	peers := make(map[NoisePublicKey]*ipcPeerConfig)
+	var peer *ipcPeerConfig
+	var peerKey NoisePublicKey
+
+	set := func(key, value string) error {
+		switch key {
+
+		case "public_key":
+			if err := peerKey.FromHex(value); err != nil {
+				logError.Println("Failed to get peer by public key:", err)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer = peers[peerKey]
+			if peer == nil {
+				peer = &ipcPeerConfig{}
+				peers[peerKey] = peer
+			}
+
+		case "update_only":
+			if value != "true" {
+				logError.Println("Failed to set update only, invalid value:", value)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer.updateOnly = true
+
+		case "remove":
+
+			// drop the peer from the set, later lines of the section are ignored
+
+			if value != "true" {
+				logError.Println("Failed to set remove, invalid value:", value)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			delete(peers, peerKey)
+			peer = &ipcPeerConfig{}
+
+		case "preshared_key":
+			if err := peer.presharedKey.FromHex(value); err != nil {
+				logError.Println("Failed to set preshared key:", err)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+
+		case "endpoint":
+			endpoint, err := conn.CreateEndpoint(value)
+			if err != nil {
+				logError.Println("Failed to set endpoint:", err, ":", value)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer.endpoint = endpoint
+
+		case "persistent_keepalive_interval":
+			secs, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				logError.Println("Failed to set persistent keepalive interval:", err)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer.keepalive = uint16(secs)
+
+		case "replace_allowed_ips":
+			if value != "true" {
+				logError.Println("Failed to replace allowedips, invalid value:", value)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer.allowedIPs = nil
+
+		case "allowed_ip":
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				logError.Println("Failed to set allowed ip:", err)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			peer.allowedIPs = append(peer.allowedIPs, network)
+
+		case "protocol_version":
+			if value != "1" {
+				logError.Println("Invalid protocol version:", value)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+
+		default:
+			logError.Println("Invalid UAPI peer key:", key)
+			return &IPCError{ipc.IpcErrorInvalid}
+		}
+		return nil
+	}
+
+	if err := set("public_key", publicKey); err != nil {
+		return nil, err
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		parts := strings.Split(line, "=")
+		if len(parts) != 2 {
+			return nil, &IPCError{ipc.IpcErrorProtocol}
+		}
+		if err := set(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return peers, nil
+}
+
+/* Replaces the peer set of the device with the staged peers as a whole,
+ * under the peer map lock.
+ *
+ * Listed peers that already exist are kept and have their configuration
+ * replaced, as if newly created, except for the endpoint, which is kept
+ * when none is given: it may have been learned by roaming and is needed
+ * to keep the session going. The session is only expired when the
+ * preshared key changes, and a keepalive is only sent when persistent
+ * keepalives are turned on.
+ */
+func (device *Device) replacePeers(peers map[NoisePublicKey]*ipcPeerConfig) error {
+	logError := device.log.Error
+	logDebug := device.log.Debug
+
+	logDebug.Println("UAPI: Replacing all peers")
+
+	if device.isClosed.Get() {
+		logError.Println("Failed to replace peers: device closed")
+		return &IPCError{ipc.IpcErrorInvalid}
+	}
+
+	device.staticIdentity.RLock()
+	defer device.staticIdentity.RUnlock()
+
+	device.peers.Lock()
+	defer device.peers.Unlock()
+
+	// ignore peer with public key of device
+
+	delete(peers, device.staticIdentity.publicKey)
+
+	// check the resulting number of peers before changing anything
+
+	count := 0
+	for publicKey, config := range peers {
+		if _, ok := device.peers.keyMap[publicKey]; ok || !config.updateOnly {
+			count++
+		}
+	}
+	if count > MaxPeers {
+		logError.Println("Failed to replace peers: too many peers")
+		return &IPCError{ipc.IpcErrorInvalid}
+	}
+
+	// remove unlisted peers first, making room for new ones
+
+	for publicKey, peer := range device.peers.keyMap {
+		if _, ok := peers[publicKey]; !ok {
+			logDebug.Println(peer, "- UAPI: Removing")
+			unsafeRemovePeer(device, peer, publicKey)
+		}
+	}
+
+	for publicKey, config := range peers {
+		peer, existed := device.peers.keyMap[publicKey]
+		if !existed {
+			if config.updateOnly {
+				continue
+			}
+			var err error
+			peer, err = unsafeNewPeer(device, publicKey)
+			if err != nil {
+				logError.Println("Failed to create new peer:", err)
+				return &IPCError{ipc.IpcErrorInvalid}
+			}
+			logDebug.Println(peer, "- UAPI: Created")
+		} else {
+			logDebug.Println(peer, "- UAPI: Updating configuration")
+		}
+
+		peer.handshake.mutex.Lock()
+		changed := !peer.handshake.presharedKey.Equals(config.presharedKey)
+		peer.handshake.presharedKey = config.presharedKey
+		peer.handshake.mutex.Unlock()
+
+		if existed && changed {
+			logDebug.Println(peer, "- UAPI: Preshared key changed, expiring session")
+			peer.ExpireCurrentKeypairs()
+		}
+
+		if config.endpoint != nil {
+			peer.Lock()
+			peer.endpoint = config.endpoint
+			peer.Unlock()
+		}
+
+		device.allowedips.RemoveByPeer(peer)
+		for _, network := range config.allowedIPs {
+			ones, _ := network.Mask.Size()
+			device.allowedips.Insert(network.IP, uint(ones), peer)
+		}
+
+		old := peer.persistentKeepaliveInterval
+		peer.persistentKeepaliveInterval = config.keepalive
+		if old == 0 && config.keepalive != 0 && device.isUp.Get() {
+			peer.SendKeepalive()
+		}
+	}
+
 	return nil
 }
 
@@ -437,6 +672,23 @@ func (device *Device) IpcHandle(socket net.Conn) {
 			status = &IPCError{1}
 		}
 
+	case "stats=1\n":
+		err = json.NewEncoder(buffered.Writer).Encode(device.Stats())
+		if err != nil {
+			status = &IPCError{ipc.IpcErrorIO}
+		}
+
+	case "health=1\n", "health=session\n":
+		health := device.Health
+		if op == "health=session\n" {
+			health = device.SessionHealth
+		}
+		// an unhealthy device is an expected answer, not an error worth logging
+		if err := health(); err != nil {
+			fmt.Fprintf(buffered, "error=%v\nerrno=%d\n\n", err, ipc.IpcErrorIO)
+			return
+		}
+
 	default:
 		device.log.Error.Println("Invalid UAPI operation:", op)
 		return
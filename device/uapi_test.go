@@ -0,0 +1,172 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func ipcSet(t *testing.T, device *Device, cfg string) {
+	t.Helper()
+	if err := device.IpcSetOperation(bufio.NewReader(strings.NewReader(cfg))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIpcReplacePeersKeepsListedPeers(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	var keys [3]NoisePublicKey
+	for i := range keys {
+		sk, err := newPrivateKey()
+		assertNil(t, err)
+		keys[i] = sk.publicKey()
+	}
+
+	ipcSet(t, device, `public_key=`+keys[0].ToHex()+`
+preshared_key=0101010101010101010101010101010101010101010101010101010101010101
+persistent_keepalive_interval=25
+endpoint=192.168.0.1:51820
+allowed_ip=10.0.0.1/32
+public_key=`+keys[1].ToHex()+`
+allowed_ip=10.0.0.2/32
+`)
+	kept := device.LookupPeer(keys[0])
+	if kept == nil || device.LookupPeer(keys[1]) == nil {
+		t.Fatal("peers were not created")
+	}
+	kept.keypairs.Lock()
+	kept.keypairs.current = new(Keypair)
+	kept.keypairs.Unlock()
+
+	ipcSet(t, device, `replace_peers=true
+public_key=`+keys[0].ToHex()+`
+allowed_ip=10.0.1.1/32
+public_key=`+keys[2].ToHex()+`
+`)
+
+	if device.LookupPeer(keys[0]) != kept {
+		t.Error("listed peer was recreated instead of kept")
+	}
+	if device.LookupPeer(keys[1]) != nil {
+		t.Error("unlisted peer was not removed")
+	}
+	if device.LookupPeer(keys[2]) == nil {
+		t.Error("new peer was not created")
+	}
+	if !kept.handshake.presharedKey.Equals(NoiseSymmetricKey{}) {
+		t.Error("preshared key of kept peer was not reset")
+	}
+	if kept.keypairs.Current().sendNonce != RejectAfterMessages {
+		t.Error("session of kept peer did not expire after its preshared key changed")
+	}
+	if kept.persistentKeepaliveInterval != 0 {
+		t.Error("keepalive interval of kept peer was not reset")
+	}
+	if kept.endpoint == nil || kept.endpoint.DstToString() != "192.168.0.1:51820" {
+		t.Error("endpoint of kept peer was not kept")
+	}
+	ips := device.allowedips.EntriesForPeer(kept)
+	if len(ips) != 1 || ips[0].String() != "10.0.1.1/32" {
+		t.Errorf("allowed ips of kept peer = %v, want [10.0.1.1/32]", ips)
+	}
+}
+
+func TestIpcReplacePeersAtMaxPeers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creating MaxPeers peers is slow")
+	}
+
+	device := randDevice(t)
+	defer device.Close()
+
+	for i := 0; i < MaxPeers; i++ {
+		sk, err := newPrivateKey()
+		assertNil(t, err)
+		_, err = device.NewPeer(sk.publicKey())
+		assertNil(t, err)
+	}
+
+	sk, err := newPrivateKey()
+	assertNil(t, err)
+	key := sk.publicKey()
+
+	ipcSet(t, device, `replace_peers=true
+public_key=`+key.ToHex()+`
+`)
+
+	if device.LookupPeer(key) == nil {
+		t.Error("new peer was not created")
+	}
+	if n := len(device.peers.keyMap); n != 1 {
+		t.Errorf("%d peers after replacement, want 1", n)
+	}
+}
+
+func TestIpcReplacePeersIsAtomic(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	var keys [3]NoisePublicKey
+	for i := range keys {
+		sk, err := newPrivateKey()
+		assertNil(t, err)
+		keys[i] = sk.publicKey()
+	}
+
+	ipcSet(t, device, `public_key=`+keys[0].ToHex()+`
+preshared_key=0101010101010101010101010101010101010101010101010101010101010101
+allowed_ip=10.0.0.1/32
+public_key=`+keys[1].ToHex()+`
+allowed_ip=10.0.0.2/32
+`)
+	kept := device.LookupPeer(keys[0])
+
+	err := device.IpcSetOperation(bufio.NewReader(strings.NewReader(`replace_peers=true
+public_key=` + keys[0].ToHex() + `
+allowed_ip=10.0.1.1/32
+public_key=` + keys[2].ToHex() + `
+allowed_ip=invalid
+`)))
+	if err == nil {
+		t.Fatal("invalid configuration was accepted")
+	}
+
+	if device.LookupPeer(keys[0]) != kept || device.LookupPeer(keys[1]) == nil {
+		t.Error("peers were removed by a failed replacement")
+	}
+	if device.LookupPeer(keys[2]) != nil {
+		t.Error("peer was created by a failed replacement")
+	}
+	if kept.handshake.presharedKey.Equals(NoiseSymmetricKey{}) {
+		t.Error("preshared key was reset by a failed replacement")
+	}
+	ips := device.allowedips.EntriesForPeer(kept)
+	if len(ips) != 1 || ips[0].String() != "10.0.0.1/32" {
+		t.Errorf("allowed ips = %v after a failed replacement, want [10.0.0.1/32]", ips)
+	}
+}
+
+func TestIpcSetPresharedKeyKeepsSession(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	peer := randPeer(t, device)
+	peer.keypairs.Lock()
+	peer.keypairs.current = new(Keypair)
+	peer.keypairs.Unlock()
+
+	ipcSet(t, device, `public_key=`+peer.handshake.remoteStatic.ToHex()+`
+preshared_key=0101010101010101010101010101010101010101010101010101010101010101
+`)
+
+	if peer.keypairs.Current().sendNonce == RejectAfterMessages {
+		t.Error("session expired on a preshared key change outside replace_peers")
+	}
+}
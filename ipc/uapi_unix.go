@@ -31,6 +31,12 @@ func sockPath(iface string) string {
 	return fmt.Sprintf("%s/%s.sock", socketDirectory, iface)
 }
 
+// StatsPath returns the path of the statistics snapshot of an interface,
+// next to its UAPI socket.
+func StatsPath(iface string) string {
+	return fmt.Sprintf("%s/%s.stats", socketDirectory, iface)
+}
+
 func UAPIOpen(name string) (*os.File, error) {
 	if err := os.MkdirAll(socketDirectory, 0755); err != nil {
 		return nil, err
@@ -8,12 +8,19 @@
 package main
 
 import (
+	"encoding/json"
+	"expvar"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
 	"syscall"
+	"time"
 
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/ipc"
@@ -26,11 +33,36 @@ const (
 )
 
 const (
-	ENV_WG_TUN_FD             = "WG_TUN_FD"
-	ENV_WG_UAPI_FD            = "WG_UAPI_FD"
-	ENV_WG_PROCESS_FOREGROUND = "WG_PROCESS_FOREGROUND"
+	ENV_WG_TUN_FD              = "WG_TUN_FD"
+	ENV_WG_UAPI_FD             = "WG_UAPI_FD"
+	ENV_WG_PROCESS_FOREGROUND  = "WG_PROCESS_FOREGROUND"
+	ENV_WG_METRICS_ADDR        = "WG_METRICS_ADDR"
+	ENV_WG_METRICS_FD          = "WG_METRICS_FD"
+	ENV_WG_DEBUG_ADDR          = "WG_DEBUG_ADDR"
+	ENV_WG_DEBUG_FD            = "WG_DEBUG_FD"
+	ENV_WG_WORKERS             = "WG_WORKERS"
+	ENV_WG_TIMESTAMP_TOLERANCE = "WG_TIMESTAMP_TOLERANCE"
 )
 
+/* Opens the TCP listener configured by addrEnv,
+ * or adopts the one passed down by the parent process in fdEnv
+ */
+func openListener(addrEnv, fdEnv string) (net.Listener, error) {
+	if fdStr := os.Getenv(fdEnv); fdStr != "" {
+		fd, err := strconv.ParseUint(fdStr, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		file := os.NewFile(uintptr(fd), "")
+		defer file.Close()
+		return net.FileListener(file)
+	}
+	if addr := os.Getenv(addrEnv); addr != "" {
+		return net.Listen("tcp", addr)
+	}
+	return nil, nil
+}
+
 func printUsage() {
 	fmt.Printf("usage:\n")
 	fmt.Printf("%s [-f/--foreground] INTERFACE-NAME\n", os.Args[0])
@@ -107,6 +139,30 @@ func main() {
 		return device.LogLevelInfo
 	}()
 
+	// get number of workers (default: one per CPU, at most four per CPU)
+
+	workers := 0
+	if workersStr := os.Getenv(ENV_WG_WORKERS); workersStr != "" {
+		n, err := strconv.Atoi(workersStr)
+		if err != nil || n < 1 || n > 4*runtime.NumCPU() {
+			fmt.Fprintln(os.Stderr, "Invalid number of workers:", workersStr)
+			os.Exit(ExitSetupFailed)
+		}
+		workers = n
+	}
+
+	// get handshake timestamp tolerance (default: none)
+
+	var timestampTolerance time.Duration
+	if toleranceStr := os.Getenv(ENV_WG_TIMESTAMP_TOLERANCE); toleranceStr != "" {
+		tolerance, err := time.ParseDuration(toleranceStr)
+		if err != nil || tolerance < 0 {
+			fmt.Fprintln(os.Stderr, "Invalid handshake timestamp tolerance:", toleranceStr)
+			os.Exit(ExitSetupFailed)
+		}
+		timestampTolerance = tolerance
+	}
+
 	// open TUN device (or use supplied fd)
 
 	tun, err := func() (tun.Device, error) {
@@ -175,6 +231,23 @@ func main() {
 		os.Exit(ExitSetupFailed)
 		return
 	}
+
+	// open metrics listener (optional)
+
+	metricsListener, err := openListener(ENV_WG_METRICS_ADDR, ENV_WG_METRICS_FD)
+	if err != nil {
+		logger.Error.Println("Metrics listen error:", err)
+		os.Exit(ExitSetupFailed)
+	}
+
+	// open debug listener (optional)
+
+	debugListener, err := openListener(ENV_WG_DEBUG_ADDR, ENV_WG_DEBUG_FD)
+	if err != nil {
+		logger.Error.Println("Debug listen error:", err)
+		os.Exit(ExitSetupFailed)
+	}
+
 	// daemonize the process
 
 	if !foreground {
@@ -201,8 +274,26 @@ func main() {
 				fileUAPI,
 			},
 			Dir: ".",
-			Env: env,
 		}
+		for _, l := range []struct {
+			listener net.Listener
+			fdEnv    string
+		}{
+			{metricsListener, ENV_WG_METRICS_FD},
+			{debugListener, ENV_WG_DEBUG_FD},
+		} {
+			if l.listener == nil {
+				continue
+			}
+			file, err := l.listener.(*net.TCPListener).File()
+			if err != nil {
+				logger.Error.Println("Failed to pass on listener:", err)
+				os.Exit(ExitSetupFailed)
+			}
+			env = append(env, fmt.Sprintf("%s=%d", l.fdEnv, len(attr.Files)))
+			attr.Files = append(attr.Files, file)
+		}
+		attr.Env = env
 
 		path, err := os.Executable()
 		if err != nil {
@@ -223,7 +314,9 @@ func main() {
 		return
 	}
 
-	device := device.NewDevice(tun, logger)
+	device := device.NewDeviceWithWorkers(tun, logger, workers)
+
+	device.SetHandshakeTimestampTolerance(timestampTolerance)
 
 	logger.Info.Println("Device started")
 
@@ -249,11 +342,75 @@ func main() {
 
 	logger.Info.Println("UAPI listener started")
 
+	// serve metrics and health (optional)
+
+	if metricsListener != nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			device.WriteMetrics(w)
+		})
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			health := device.Health
+			if r.URL.Query().Get("session") == "1" {
+				health = device.SessionHealth
+			}
+			if err := health(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		})
+		go func() {
+			err := http.Serve(metricsListener, mux)
+			logger.Error.Println("Metrics listener failed:", err)
+		}()
+		logger.Info.Println("Metrics listener started on", metricsListener.Addr())
+	}
+
+	// serve expvar and pprof (optional)
+
+	if debugListener != nil {
+		expvar.Publish("wireguard", expvar.Func(func() interface{} {
+			return device.Stats()
+		}))
+		go func() {
+			err := http.Serve(debugListener, http.DefaultServeMux)
+			logger.Error.Println("Debug listener failed:", err)
+		}()
+		logger.Info.Println("Debug listener started on", debugListener.Addr())
+	}
+
 	// wait for program to terminate
 
 	signal.Notify(term, syscall.SIGTERM)
 	signal.Notify(term, os.Interrupt)
 
+	// dump statistics on request, to a file so that it survives daemonizing
+
+	statsPath := ipc.StatsPath(interfaceName)
+	dump := make(chan os.Signal, 1)
+	signal.Notify(dump, syscall.SIGUSR1)
+	go func() {
+		for range dump {
+			stats, err := json.Marshal(device.Stats())
+			if err != nil {
+				logger.Error.Println("Failed to encode statistics:", err)
+				continue
+			}
+			tmpPath := statsPath + ".tmp"
+			err = ioutil.WriteFile(tmpPath, append(stats, '\n'), 0600)
+			if err == nil {
+				err = os.Rename(tmpPath, statsPath)
+			}
+			if err != nil {
+				logger.Error.Println("Failed to write statistics:", err)
+				continue
+			}
+			logger.Info.Println("Statistics written to", statsPath)
+		}
+	}()
+
 	select {
 	case <-term:
 	case <-errs:
@@ -264,6 +421,7 @@ func main() {
 
 	uapi.Close()
 	device.Close()
+	os.Remove(statsPath)
 
 	logger.Info.Println("Shutting down")
 }
@@ -33,3 +33,14 @@ func Now() Timestamp {
 func (t1 Timestamp) After(t2 Timestamp) bool {
 	return bytes.Compare(t1[:], t2[:]) > 0
 }
+
+func (t Timestamp) time() time.Time {
+	secs := int64(binary.BigEndian.Uint64(t[:]) - base)
+	nano := int64(binary.BigEndian.Uint32(t[8:]))
+	return time.Unix(secs, nano)
+}
+
+// Add returns the timestamp shifted by d, subject to the same whitening as Now.
+func (t Timestamp) Add(d time.Duration) Timestamp {
+	return stamp(t.time().Add(d))
+}
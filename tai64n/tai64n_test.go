@@ -38,3 +38,16 @@ func TestMonotonic(t *testing.T) {
 		})
 	}
 }
+
+func TestAdd(t *testing.T) {
+	now := stamp(time.Unix(1600000000, 0))
+	if !now.Add(time.Second).After(now) {
+		t.Error("adding a second did not move the timestamp forward")
+	}
+	if !now.After(now.Add(-time.Second)) {
+		t.Error("subtracting a second did not move the timestamp backward")
+	}
+	if now.Add(time.Minute).Add(-time.Minute) != now {
+		t.Error("adding and subtracting a minute did not round trip")
+	}
+}